@@ -0,0 +1,251 @@
+package plugin
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// bundleExtensions lists the archive formats accepted as multi-component
+// plugin bundles when found on PACKER_PLUGIN_PATH.
+var bundleExtensions = []string{".tar.gz", ".tgz", ".zip"}
+
+// isPluginBundle reports whether file is a plugin bundle archive rather
+// than a plugin binary, so discovery globs don't try to launch it.
+func isPluginBundle(file string) bool {
+	for _, ext := range bundleExtensions {
+		if strings.HasSuffix(file, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// extractedBundles tracks the temp directories created by extracting
+// bundles during discovery so that CleanupBundles can remove them on
+// shutdown.
+var (
+	extractedBundlesMu sync.Mutex
+	extractedBundles   []string
+)
+
+// discoverBundles finds any archive bundles in dir, extracts each into its
+// own temp directory (never back into dir, which may not even be
+// writable), and runs discovery again against the extracted directory so
+// the bundle's manifest and binary are picked up exactly like a loose
+// plugin would be.
+func (c *Config) discoverBundles(dir string) error {
+	for _, ext := range bundleExtensions {
+		matches, err := filepath.Glob(filepath.Join(dir, "*"+ext))
+		if err != nil {
+			return fmt.Errorf("error globbing %s plugin bundles: %s", dir, err)
+		}
+
+		for _, bundle := range matches {
+			extractDir, err := extractBundle(bundle)
+			if err != nil {
+				return fmt.Errorf("error extracting plugin bundle %s: %s", bundle, err)
+			}
+
+			extractedBundlesMu.Lock()
+			extractedBundles = append(extractedBundles, extractDir)
+			extractedBundlesMu.Unlock()
+
+			if err := c.discoverSingle(extractDir); err != nil {
+				return err
+			}
+			if err := c.discoverMulti(extractDir); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// InstallBundle extracts the bundle at path into Packer's plugin
+// directory (~/.packer.d/plugins) for user-driven `packer plugins
+// install`-style workflows.
+func InstallBundle(path string) error {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return fmt.Errorf("error finding home directory: %s", err)
+	}
+
+	dest := filepath.Join(home, ".packer.d", "plugins")
+	if err := os.MkdirAll(dest, 0755); err != nil {
+		return fmt.Errorf("error creating plugin directory: %s", err)
+	}
+
+	if err := extractArchive(path, dest); err != nil {
+		return fmt.Errorf("error installing plugin bundle %s: %s", path, err)
+	}
+
+	return nil
+}
+
+// CleanupBundles removes every temp directory created by extracting
+// bundles during this process's discovery calls. It should be called on
+// shutdown.
+func CleanupBundles() {
+	extractedBundlesMu.Lock()
+	defer extractedBundlesMu.Unlock()
+
+	for _, dir := range extractedBundles {
+		if err := os.RemoveAll(dir); err != nil {
+			log.Printf("[WARN] failed to clean up extracted plugin bundle %s: %s", dir, err)
+		}
+	}
+	extractedBundles = nil
+}
+
+// extractBundle extracts bundle into a fresh temp directory and returns
+// its path.
+func extractBundle(bundle string) (string, error) {
+	dir, err := ioutil.TempDir("", "packer-plugin-bundle-")
+	if err != nil {
+		return "", err
+	}
+
+	if err := extractArchive(bundle, dir); err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+
+	return dir, nil
+}
+
+func extractArchive(archivePath, destDir string) error {
+	switch {
+	case strings.HasSuffix(archivePath, ".tar.gz"), strings.HasSuffix(archivePath, ".tgz"):
+		return extractTarGz(archivePath, destDir)
+	case strings.HasSuffix(archivePath, ".zip"):
+		return extractZip(archivePath, destDir)
+	default:
+		return fmt.Errorf("unsupported plugin bundle format: %s", archivePath)
+	}
+}
+
+func extractTarGz(archivePath, destDir string) error {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		target, err := safeJoin(destDir, hdr.Name)
+		if err != nil {
+			return err
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			if err := writeExtractedFile(target, tr, os.FileMode(hdr.Mode)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func extractZip(archivePath, destDir string) error {
+	r, err := zip.OpenReader(archivePath)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	for _, f := range r.File {
+		target, err := safeJoin(destDir, f.Name)
+		if err != nil {
+			return err
+		}
+
+		if f.FileInfo().IsDir() {
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			return err
+		}
+		err = writeExtractedFile(target, rc, f.Mode())
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// safeJoin joins destDir with the archive-provided name, rejecting any
+// entry whose cleaned path would escape destDir via ".." components or an
+// absolute path.
+func safeJoin(destDir, name string) (string, error) {
+	if filepath.IsAbs(name) {
+		return "", fmt.Errorf("plugin bundle entry has an absolute path: %s", name)
+	}
+
+	target := filepath.Join(destDir, name)
+	destDirWithSep := destDir + string(os.PathSeparator)
+	if target != destDir && !strings.HasPrefix(target, destDirWithSep) {
+		return "", fmt.Errorf("plugin bundle entry escapes extraction directory: %s", name)
+	}
+
+	return target, nil
+}
+
+// writeExtractedFile writes r to target, preserving mode so that plugin
+// binaries keep their executable bit.
+func writeExtractedFile(target string, r io.Reader, mode os.FileMode) error {
+	if mode == 0 {
+		mode = 0644
+	}
+
+	out, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	_, err = io.Copy(out, r)
+	return err
+}
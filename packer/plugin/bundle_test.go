@@ -0,0 +1,211 @@
+package plugin
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeTarGz(t *testing.T, path string, entries map[string]string) {
+	t.Helper()
+
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("failed to create bundle: %s", err)
+	}
+	defer f.Close()
+
+	gz := gzip.NewWriter(f)
+	defer gz.Close()
+
+	tw := tar.NewWriter(gz)
+	defer tw.Close()
+
+	for name, content := range entries {
+		hdr := &tar.Header{
+			Name: name,
+			Mode: 0755,
+			Size: int64(len(content)),
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatalf("failed to write tar header: %s", err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatalf("failed to write tar entry: %s", err)
+		}
+	}
+}
+
+func TestDiscoverBundles_good(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pkr-bundle-test")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	manifest := `{
+		"id": "com.example.packer-plugin-bundled",
+		"version": "1.0.0",
+		"builders": ["thing"]
+	}`
+
+	writeTarGz(t, filepath.Join(dir, "packer-plugin-bundled.tar.gz"), map[string]string{
+		"packer-plugin-bundled":               "#!/bin/sh\nexit 1\n",
+		"packer-plugin-bundled.manifest.json": manifest,
+	})
+
+	os.Setenv("PACKER_PLUGIN_PATH", dir)
+	defer os.Unsetenv("PACKER_PLUGIN_PATH")
+
+	c := newConfig()
+	if err := c.Discover(); err != nil {
+		t.Fatalf("Discover() returned error: %s", err)
+	}
+
+	if _, ok := c.builders["bundled-thing"]; !ok {
+		t.Error("expected bundled builder to be registered")
+	}
+
+	info, err := os.Stat(filepath.Join(extractedBundles[len(extractedBundles)-1], "packer-plugin-bundled"))
+	if err != nil {
+		t.Fatalf("expected extracted binary to exist: %s", err)
+	}
+	if info.Mode()&0111 == 0 {
+		t.Error("expected extracted binary to preserve its executable bit")
+	}
+
+	CleanupBundles()
+}
+
+func TestDiscoverBundles_pathTraversal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pkr-bundle-traversal-test")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeTarGz(t, filepath.Join(dir, "packer-plugin-evil.tar.gz"), map[string]string{
+		"../../etc/evil": "pwned",
+	})
+
+	os.Setenv("PACKER_PLUGIN_PATH", dir)
+	defer os.Unsetenv("PACKER_PLUGIN_PATH")
+
+	c := newConfig()
+	err = c.Discover()
+	if err == nil {
+		t.Fatal("expected an error extracting a bundle with a path traversal entry")
+	}
+}
+
+func TestDiscoverBundles_zipPathTraversal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pkr-bundle-zip-traversal-test")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	archivePath := filepath.Join(dir, "packer-plugin-evil.zip")
+	f, err := os.Create(archivePath)
+	if err != nil {
+		t.Fatalf("failed to create zip: %s", err)
+	}
+	zw := zip.NewWriter(f)
+	w, err := zw.Create("../escaped")
+	if err != nil {
+		t.Fatalf("failed to add zip entry: %s", err)
+	}
+	if _, err := w.Write([]byte("pwned")); err != nil {
+		t.Fatalf("failed to write zip entry: %s", err)
+	}
+	zw.Close()
+	f.Close()
+
+	os.Setenv("PACKER_PLUGIN_PATH", dir)
+	defer os.Unsetenv("PACKER_PLUGIN_PATH")
+
+	c := newConfig()
+	if err := c.Discover(); err == nil {
+		t.Fatal("expected an error extracting a zip bundle with a path traversal entry")
+	}
+}
+
+func TestInstallBundle(t *testing.T) {
+	home, err := ioutil.TempDir("", "pkr-install-bundle-home")
+	if err != nil {
+		t.Fatalf("failed to create temp home dir: %s", err)
+	}
+	defer os.RemoveAll(home)
+
+	origHome := os.Getenv("HOME")
+	os.Setenv("HOME", home)
+	defer os.Setenv("HOME", origHome)
+
+	bundleDir, err := ioutil.TempDir("", "pkr-install-bundle-src")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(bundleDir)
+
+	bundlePath := filepath.Join(bundleDir, "packer-plugin-installed.tar.gz")
+	writeTarGz(t, bundlePath, map[string]string{
+		"packer-plugin-installed": "#!/bin/sh\nexit 1\n",
+	})
+
+	if err := InstallBundle(bundlePath); err != nil {
+		t.Fatalf("InstallBundle returned error: %s", err)
+	}
+
+	installedPath := filepath.Join(home, ".packer.d", "plugins", "packer-plugin-installed")
+	info, err := os.Stat(installedPath)
+	if err != nil {
+		t.Fatalf("expected installed binary to exist at %s: %s", installedPath, err)
+	}
+	if info.Mode()&0111 == 0 {
+		t.Error("expected installed binary to preserve its executable bit")
+	}
+}
+
+func TestDiscoverBundles_mixedLooseAndBundled(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pkr-bundle-mixed-test")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// A loose legacy plugin sitting alongside the bundle.
+	if err := ioutil.WriteFile(filepath.Join(dir, ProvisionerPluginPrefix+"partyparrot"), []byte(""), 0644); err != nil {
+		t.Fatalf("failed to write loose plugin: %s", err)
+	}
+
+	manifest := `{
+		"id": "com.example.packer-plugin-bundled",
+		"version": "1.0.0",
+		"builders": ["thing"]
+	}`
+	writeTarGz(t, filepath.Join(dir, "packer-plugin-bundled.tar.gz"), map[string]string{
+		"packer-plugin-bundled":               "#!/bin/sh\nexit 1\n",
+		"packer-plugin-bundled.manifest.json": manifest,
+	})
+
+	os.Setenv("PACKER_PLUGIN_PATH", dir)
+	defer os.Unsetenv("PACKER_PLUGIN_PATH")
+
+	c := newConfig()
+	if err := c.Discover(); err != nil {
+		t.Fatalf("Discover() returned error: %s", err)
+	}
+
+	if _, ok := c.provisioners["partyparrot"]; !ok {
+		t.Error("expected loose provisioner to still be discovered")
+	}
+	if _, ok := c.builders["bundled-thing"]; !ok {
+		t.Error("expected bundled builder to be discovered")
+	}
+
+	CleanupBundles()
+}
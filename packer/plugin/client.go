@@ -0,0 +1,142 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/packer/packer-plugin-sdk/packer"
+)
+
+// pluginBuilder, pluginProvisioner and pluginPostProcessor are thin proxies
+// returned by discovery. Each call re-dials the plugin's Supervisor rather
+// than caching a single RPC stub, so that a plugin restarted after a crash
+// is picked up transparently on the caller's very next call.
+
+type pluginBuilder struct {
+	name   string
+	path   string
+	config *Config
+}
+
+func (p *pluginBuilder) dial() (*packer.RemoteBuilder, error) {
+	client, err := p.config.supervisorFor(p.path).Client()
+	if err != nil {
+		return nil, err
+	}
+
+	builder, err := client.Builder(p.name)
+	if err != nil {
+		return nil, fmt.Errorf("error launching builder plugin %s: %s", p.name, err)
+	}
+	return builder, nil
+}
+
+func (p *pluginBuilder) ConfigSpec() packer.HCL2Spec {
+	builder, err := p.dial()
+	if err != nil {
+		return nil
+	}
+	return builder.ConfigSpec()
+}
+
+func (p *pluginBuilder) Prepare(raws ...interface{}) ([]string, []string, error) {
+	builder, err := p.dial()
+	if err != nil {
+		return nil, nil, err
+	}
+	return builder.Prepare(raws...)
+}
+
+func (p *pluginBuilder) Run(ctx context.Context, ui packer.Ui, hook packer.Hook) (packer.Artifact, error) {
+	builder, err := p.dial()
+	if err != nil {
+		return nil, err
+	}
+	return builder.Run(ctx, ui, hook)
+}
+
+type pluginProvisioner struct {
+	name   string
+	path   string
+	config *Config
+}
+
+func (p *pluginProvisioner) dial() (*packer.RemoteProvisioner, error) {
+	client, err := p.config.supervisorFor(p.path).Client()
+	if err != nil {
+		return nil, err
+	}
+
+	provisioner, err := client.Provisioner(p.name)
+	if err != nil {
+		return nil, fmt.Errorf("error launching provisioner plugin %s: %s", p.name, err)
+	}
+	return provisioner, nil
+}
+
+func (p *pluginProvisioner) ConfigSpec() packer.HCL2Spec {
+	provisioner, err := p.dial()
+	if err != nil {
+		return nil
+	}
+	return provisioner.ConfigSpec()
+}
+
+func (p *pluginProvisioner) Prepare(raws ...interface{}) error {
+	provisioner, err := p.dial()
+	if err != nil {
+		return err
+	}
+	return provisioner.Prepare(raws...)
+}
+
+func (p *pluginProvisioner) Provision(ctx context.Context, ui packer.Ui, comm packer.Communicator, generatedData map[string]interface{}) error {
+	provisioner, err := p.dial()
+	if err != nil {
+		return err
+	}
+	return provisioner.Provision(ctx, ui, comm, generatedData)
+}
+
+type pluginPostProcessor struct {
+	name   string
+	path   string
+	config *Config
+}
+
+func (p *pluginPostProcessor) dial() (*packer.RemotePostProcessor, error) {
+	client, err := p.config.supervisorFor(p.path).Client()
+	if err != nil {
+		return nil, err
+	}
+
+	postProcessor, err := client.PostProcessor(p.name)
+	if err != nil {
+		return nil, fmt.Errorf("error launching post-processor plugin %s: %s", p.name, err)
+	}
+	return postProcessor, nil
+}
+
+func (p *pluginPostProcessor) ConfigSpec() packer.HCL2Spec {
+	postProcessor, err := p.dial()
+	if err != nil {
+		return nil
+	}
+	return postProcessor.ConfigSpec()
+}
+
+func (p *pluginPostProcessor) Configure(raws ...interface{}) error {
+	postProcessor, err := p.dial()
+	if err != nil {
+		return err
+	}
+	return postProcessor.Configure(raws...)
+}
+
+func (p *pluginPostProcessor) PostProcess(ctx context.Context, ui packer.Ui, artifact packer.Artifact) (packer.Artifact, bool, bool, error) {
+	postProcessor, err := p.dial()
+	if err != nil {
+		return nil, false, false, err
+	}
+	return postProcessor.PostProcess(ctx, ui, artifact)
+}
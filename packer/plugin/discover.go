@@ -0,0 +1,347 @@
+// Package plugin handles the discovery, description and launching of
+// Packer plugins: external binaries that implement one or more builders,
+// provisioners or post-processors and that communicate with the Packer
+// core over RPC.
+package plugin
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/packer/packer-plugin-sdk/packer"
+	pluginsdk "github.com/hashicorp/packer/packer-plugin-sdk/plugin"
+	"golang.org/x/crypto/openpgp"
+)
+
+// Prefixes that identify the kind of component a single-purpose plugin
+// binary implements, e.g. "packer-builder-amazon-ebs". Binaries matching
+// MultiPluginPrefix are expected to implement more than one component and
+// are asked to describe themselves instead.
+const (
+	BuilderPluginPrefix       = "packer-builder-"
+	ProvisionerPluginPrefix   = "packer-provisioner-"
+	PostProcessorPluginPrefix = "packer-post-processor-"
+	MultiPluginPrefix         = "packer-plugin-"
+)
+
+// Config helps assemble the set of installed Packer plugins, either by
+// discovering plugin binaries on PACKER_PLUGIN_PATH or by registering them
+// manually. A zero-value Config is ready to use.
+type Config struct {
+	// PluginMinPort and PluginMaxPort bound the range of ports that
+	// spawned plugin processes may use to serve their RPC listener.
+	PluginMinPort uint
+	PluginMaxPort uint
+
+	// Manifests holds the parsed manifest.json for every discovered
+	// plugin that shipped one, keyed by plugin name. Plugins discovered
+	// purely by filename/describe convention have no entry here.
+	Manifests map[string]*PluginManifest
+
+	// PluginTrust controls how strictly discovered plugin binaries are
+	// checksummed and signature-verified before being registered. It
+	// defaults to TrustDisabled.
+	PluginTrust TrustLevel
+
+	// TrustedKeys is the keyring used to verify a plugin's detached
+	// ".sig" signature when PluginTrust is TrustWarn or TrustEnforce.
+	TrustedKeys openpgp.EntityList
+
+	// Checksums holds the SHA-256 checksum of every discovered plugin
+	// binary, keyed by the same component name used in builders,
+	// provisioners and postProcessors, so that e.g. `packer plugins
+	// list` can display it.
+	Checksums map[string]string
+
+	// LaunchOptions maps a plugin name to the argv, environment and
+	// working directory it should be launched with. If left nil,
+	// Discover() loads it from plugins.hcl (see defaultLaunchOptionsPath).
+	LaunchOptions map[string]*LaunchOptions
+
+	builders       map[string]packer.Builder
+	provisioners   map[string]packer.Provisioner
+	postProcessors map[string]packer.PostProcessor
+
+	supervisorsMu sync.Mutex
+	supervisors   map[string]*Supervisor
+}
+
+// Discover finds and registers plugins according to the naming and
+// directory conventions documented at
+// https://www.packer.io/docs/extending/plugins.html.
+//
+// It is a no-op, by design, when Packer is itself running as a plugin
+// (i.e. the magic cookie env var is set) since a plugin process has no
+// business discovering or launching other plugins.
+func (c *Config) Discover() error {
+	if os.Getenv(pluginsdk.MagicCookieKey) == pluginsdk.MagicCookieValue {
+		return nil
+	}
+
+	c.initMaps()
+
+	if c.LaunchOptions == nil {
+		opts, err := loadDefaultLaunchOptions()
+		if err != nil {
+			return err
+		}
+		c.LaunchOptions = opts
+	}
+
+	dirs, err := c.discoverDirs()
+	if err != nil {
+		return err
+	}
+
+	for _, dir := range dirs {
+		if err := c.discoverSingle(dir); err != nil {
+			return err
+		}
+		if err := c.discoverMulti(dir); err != nil {
+			return err
+		}
+		if err := c.discoverBundles(dir); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *Config) initMaps() {
+	if c.builders == nil {
+		c.builders = make(map[string]packer.Builder)
+	}
+	if c.provisioners == nil {
+		c.provisioners = make(map[string]packer.Provisioner)
+	}
+	if c.postProcessors == nil {
+		c.postProcessors = make(map[string]packer.PostProcessor)
+	}
+}
+
+// discoverDirs returns, in priority order, the directories that should be
+// searched for plugins: the directories listed in PACKER_PLUGIN_PATH, the
+// directory containing the current executable, and the user's plugin
+// directory (~/.packer.d/plugins).
+func (c *Config) discoverDirs() ([]string, error) {
+	var dirs []string
+
+	if v := os.Getenv("PACKER_PLUGIN_PATH"); v != "" {
+		dirs = append(dirs, filepath.SplitList(v)...)
+	}
+
+	exePath, err := os.Executable()
+	if err != nil {
+		log.Printf("[ERR] Error loading exe directory: %s", err)
+	} else {
+		dirs = append(dirs, filepath.Dir(exePath))
+	}
+
+	if home, err := os.UserHomeDir(); err == nil {
+		dirs = append(dirs, filepath.Join(home, ".packer.d", "plugins"))
+	}
+
+	return dirs, nil
+}
+
+// discoverSingle registers any single-purpose plugin binaries found in dir.
+// Registration is lazy: the plugin's filename tells us its type and name,
+// so we don't need to launch the binary until one of its methods is
+// actually invoked.
+func (c *Config) discoverSingle(dir string) error {
+	if err := c.discoverComponents(dir, BuilderPluginPrefix, func(name, path string) {
+		c.builders[name] = &pluginBuilder{name: name, path: path, config: c}
+	}); err != nil {
+		return err
+	}
+
+	if err := c.discoverComponents(dir, ProvisionerPluginPrefix, func(name, path string) {
+		c.provisioners[name] = &pluginProvisioner{name: name, path: path, config: c}
+	}); err != nil {
+		return err
+	}
+
+	return c.discoverComponents(dir, PostProcessorPluginPrefix, func(name, path string) {
+		c.postProcessors[name] = &pluginPostProcessor{name: name, path: path, config: c}
+	})
+}
+
+// isPluginSidecar reports whether file is metadata that rides alongside a
+// plugin binary (its manifest, checksum or signature) rather than a
+// binary itself, so discovery globs don't mistake it for one.
+func isPluginSidecar(file string) bool {
+	return strings.HasSuffix(file, manifestSuffix) ||
+		strings.HasSuffix(file, checksumSuffix) ||
+		strings.HasSuffix(file, signatureSuffix)
+}
+
+func (c *Config) discoverComponents(dir, prefix string, register func(name, path string)) error {
+	matches, err := filepath.Glob(filepath.Join(dir, prefix+"*"))
+	if err != nil {
+		return fmt.Errorf("error globbing %s%s plugins: %s", dir, prefix, err)
+	}
+
+	for _, match := range matches {
+		file := filepath.Base(match)
+		if strings.HasPrefix(file, MultiPluginPrefix) || isPluginSidecar(file) {
+			// handled separately by discoverMulti, or not a binary at all
+			continue
+		}
+
+		name := strings.TrimSuffix(strings.TrimPrefix(file, prefix), filepath.Ext(file))
+		log.Printf("[DEBUG] Discovered potential plugin: %s = %s", name, match)
+
+		verified, err := c.verifyPlugin(match)
+		if err != nil {
+			return err
+		}
+
+		if c.PluginTrust == TrustEnforce && !verified.Trusted {
+			log.Printf("[WARN] refusing to register unverified plugin: %s", match)
+			continue
+		}
+
+		c.recordChecksum(name, verified)
+		register(name, match)
+	}
+
+	return nil
+}
+
+// recordChecksum stashes a verified plugin's checksum for later display,
+// initializing Config.Checksums on first use.
+func (c *Config) recordChecksum(name string, verified *verifiedPlugin) {
+	if c.Checksums == nil {
+		c.Checksums = make(map[string]string)
+	}
+	c.Checksums[name] = verified.Checksum
+}
+
+// discoverMulti registers the components of any multi-plugin binaries
+// found in dir. A binary with a manifest is registered from its manifest
+// without being launched (see discoverManifest); any other binary is
+// launched and asked to describe the components it implements, each of
+// which is registered under "<plugin>-<component>".
+func (c *Config) discoverMulti(dir string) error {
+	matches, err := filepath.Glob(filepath.Join(dir, MultiPluginPrefix+"*"))
+	if err != nil {
+		return fmt.Errorf("error globbing %s plugins: %s", dir, err)
+	}
+
+	for _, match := range matches {
+		file := filepath.Base(match)
+		if isPluginSidecar(file) || isPluginBundle(file) {
+			// bundles are extracted and discovered by discoverBundles
+			continue
+		}
+		if runtime.GOOS == "windows" && filepath.Ext(file) != ".exe" {
+			continue
+		}
+
+		name := strings.TrimSuffix(strings.TrimPrefix(file, MultiPluginPrefix), filepath.Ext(file))
+
+		verified, err := c.verifyPlugin(match)
+		if err != nil {
+			return err
+		}
+		if c.PluginTrust == TrustEnforce && !verified.Trusted {
+			log.Printf("[WARN] refusing to register unverified plugin: %s", match)
+			continue
+		}
+
+		found, registered, err := c.discoverManifest(name, match)
+		if err != nil {
+			return err
+		}
+		if found {
+			if registered {
+				m := c.Manifests[name]
+				for _, component := range append(append(append([]string{}, m.Builders...), m.Provisioners...), m.PostProcessors...) {
+					c.recordChecksum(componentName(name, component), verified)
+				}
+			}
+			continue
+		}
+
+		set, err := c.describe(match)
+		if err != nil {
+			return fmt.Errorf("error describing plugin %s: %s", match, err)
+		}
+
+		for builderName := range set.Builders {
+			fullName := name + "-" + builderName
+			c.builders[fullName] = &pluginBuilder{name: builderName, path: match, config: c}
+			c.recordChecksum(fullName, verified)
+		}
+		for provisionerName := range set.Provisioners {
+			fullName := name + "-" + provisionerName
+			c.provisioners[fullName] = &pluginProvisioner{name: provisionerName, path: match, config: c}
+			c.recordChecksum(fullName, verified)
+		}
+		for postProcessorName := range set.PostProcessors {
+			fullName := name + "-" + postProcessorName
+			c.postProcessors[fullName] = &pluginPostProcessor{name: postProcessorName, path: match, config: c}
+			c.recordChecksum(fullName, verified)
+		}
+	}
+
+	return nil
+}
+
+// describe launches path and asks it, over RPC, which components it
+// provides.
+func (c *Config) describe(path string) (pluginsdk.Set, error) {
+	client, err := c.client(path)
+	if err != nil {
+		return pluginsdk.Set{}, err
+	}
+	defer client.Kill()
+
+	return client.Describe()
+}
+
+// client starts (or, in the future, re-attaches to) the plugin process at
+// path, constrained to the configured port range, and returns a handle to
+// it. Any LaunchOptions configured for this plugin are applied to the
+// child process's argv, environment and working directory.
+func (c *Config) client(path string, args ...string) (*pluginsdk.Client, error) {
+	cmd := exec.Command(path, args...)
+	if opts := c.launchOptionsFor(path); opts != nil {
+		applyLaunchOptions(cmd, opts)
+	}
+
+	return pluginsdk.NewClient(&pluginsdk.ClientConfig{
+		Cmd:     cmd,
+		MinPort: c.PluginMinPort,
+		MaxPort: c.PluginMaxPort,
+	}), nil
+}
+
+// applyLaunchOptions customizes cmd according to opts: opts.Args are
+// appended after any args the caller already passed (e.g. component name
+// flags), opts.Env is layered on top of Packer's own environment so as
+// not to clobber it, and opts.Cwd overrides the process's working
+// directory.
+func applyLaunchOptions(cmd *exec.Cmd, opts *LaunchOptions) {
+	if len(opts.Args) > 0 {
+		cmd.Args = append(cmd.Args, opts.Args...)
+	}
+
+	if opts.Cwd != "" {
+		cmd.Dir = opts.Cwd
+	}
+
+	if len(opts.Env) > 0 {
+		cmd.Env = os.Environ()
+		for k, v := range opts.Env {
+			cmd.Env = append(cmd.Env, k+"="+v)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package plugin
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hashicorp/hcl"
+)
+
+// LaunchOptions customizes how a single named plugin's process is
+// started: extra argv appended after whatever Discover() already passes,
+// environment variables injected into the child process (layered on top
+// of Packer's own environment rather than replacing it, so the plugin
+// still inherits things like PATH), and an override working directory.
+// This lets a vendored or third-party plugin take a --config flag, read
+// cloud credentials that shouldn't also be visible to Packer itself, or
+// run from a directory other than wherever its binary happens to live.
+type LaunchOptions struct {
+	Args []string          `hcl:"args"`
+	Env  map[string]string `hcl:"env"`
+	Cwd  string            `hcl:"cwd"`
+}
+
+// launchOptionsFile is the decoding target for plugins.hcl, e.g.:
+//
+//	plugin "amazon-ebs" {
+//	  args = ["--config", "/etc/packer/aws.json"]
+//	  cwd  = "/opt/vendor-plugins"
+//	  env = {
+//	    AWS_PROFILE = "prod"
+//	  }
+//	}
+type launchOptionsFile struct {
+	Plugin map[string]*LaunchOptions `hcl:"plugin"`
+}
+
+// defaultLaunchOptionsPath is where Discover() looks for per-plugin argv,
+// env and cwd configuration unless Config.LaunchOptions has already been
+// set manually.
+func defaultLaunchOptionsPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".packer.d", "plugins.hcl"), nil
+}
+
+// ParseLaunchOptions decodes a plugins.hcl payload into a map of plugin
+// name to LaunchOptions.
+func ParseLaunchOptions(data []byte) (map[string]*LaunchOptions, error) {
+	var f launchOptionsFile
+	if err := hcl.Decode(&f, string(data)); err != nil {
+		return nil, fmt.Errorf("error parsing plugin launch options: %s", err)
+	}
+	return f.Plugin, nil
+}
+
+// loadDefaultLaunchOptions reads and parses plugins.hcl from its
+// conventional location. It returns a nil map, and no error, if the file
+// doesn't exist.
+func loadDefaultLaunchOptions() (map[string]*LaunchOptions, error) {
+	path, err := defaultLaunchOptionsPath()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := readFileIfExists(path)
+	if err != nil {
+		return nil, err
+	}
+	if data == nil {
+		return nil, nil
+	}
+
+	opts, err := ParseLaunchOptions(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	return opts, nil
+}
+
+// pluginNameFromPath recovers a plugin's logical name from its binary
+// path, stripping any of the recognized discovery prefixes, so that
+// LaunchOptions can be looked up the same way regardless of whether the
+// plugin is single-purpose or multi-component.
+func pluginNameFromPath(path string) string {
+	file := filepath.Base(path)
+
+	for _, prefix := range []string{BuilderPluginPrefix, ProvisionerPluginPrefix, PostProcessorPluginPrefix, MultiPluginPrefix} {
+		if strings.HasPrefix(file, prefix) {
+			return strings.TrimSuffix(strings.TrimPrefix(file, prefix), filepath.Ext(file))
+		}
+	}
+
+	return strings.TrimSuffix(file, filepath.Ext(file))
+}
+
+// launchOptionsFor looks up the configured LaunchOptions for the plugin
+// binary at path, if any.
+func (c *Config) launchOptionsFor(path string) *LaunchOptions {
+	if c.LaunchOptions == nil {
+		return nil
+	}
+	return c.LaunchOptions[pluginNameFromPath(path)]
+}
@@ -0,0 +1,169 @@
+package plugin
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/packer/packer-plugin-sdk/packer"
+	pluginsdk "github.com/hashicorp/packer/packer-plugin-sdk/plugin"
+)
+
+func TestParseLaunchOptions(t *testing.T) {
+	raw := `
+plugin "amazon-ebs" {
+  args = ["--config", "/etc/packer/aws.json"]
+  cwd  = "/opt/vendor-plugins"
+  env = {
+    AWS_PROFILE = "prod"
+  }
+}
+`
+
+	opts, err := ParseLaunchOptions([]byte(raw))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	amazon, ok := opts["amazon-ebs"]
+	if !ok {
+		t.Fatal("expected to find launch options for amazon-ebs")
+	}
+
+	if !reflect.DeepEqual(amazon.Args, []string{"--config", "/etc/packer/aws.json"}) {
+		t.Errorf("unexpected args: %#v", amazon.Args)
+	}
+	if amazon.Cwd != "/opt/vendor-plugins" {
+		t.Errorf("unexpected cwd: %s", amazon.Cwd)
+	}
+	if amazon.Env["AWS_PROFILE"] != "prod" {
+		t.Errorf("unexpected env: %#v", amazon.Env)
+	}
+}
+
+func TestPluginNameFromPath(t *testing.T) {
+	cases := map[string]string{
+		"/usr/local/bin/packer-builder-amazon-ebs": "amazon-ebs",
+		"/usr/local/bin/packer-provisioner-shell":  "shell",
+		"/usr/local/bin/packer-plugin-bird":        "bird",
+		"/usr/local/bin/packer-plugin-bird.exe":    "bird",
+	}
+
+	for path, want := range cases {
+		if got := pluginNameFromPath(path); got != want {
+			t.Errorf("pluginNameFromPath(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
+
+func TestApplyLaunchOptions(t *testing.T) {
+	cmd := exec.Command("/usr/local/bin/packer-plugin-bird", "describe")
+
+	applyLaunchOptions(cmd, &LaunchOptions{
+		Args: []string{"--config", "/etc/packer/bird.json"},
+		Cwd:  "/opt/vendor-plugins",
+		Env:  map[string]string{"PKR_BIRD_TOKEN": "secret"},
+	})
+
+	wantArgs := []string{"/usr/local/bin/packer-plugin-bird", "describe", "--config", "/etc/packer/bird.json"}
+	if !reflect.DeepEqual(cmd.Args, wantArgs) {
+		t.Errorf("unexpected args: %#v", cmd.Args)
+	}
+
+	if cmd.Dir != "/opt/vendor-plugins" {
+		t.Errorf("unexpected dir: %s", cmd.Dir)
+	}
+
+	found := false
+	for _, kv := range cmd.Env {
+		if kv == "PKR_BIRD_TOKEN=secret" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("expected PKR_BIRD_TOKEN=secret in env, got: %v", cmd.Env)
+	}
+
+	// The process's own environment should still be present alongside
+	// the injected variable, not replaced by it.
+	if len(cmd.Env) < 2 {
+		t.Errorf("expected injected env to be layered on top of the existing environment, got: %v", cmd.Env)
+	}
+}
+
+func TestConfig_launchOptionsForFindsByName(t *testing.T) {
+	c := newConfig()
+	c.LaunchOptions = map[string]*LaunchOptions{
+		"bird": {Args: []string{"--flag"}},
+	}
+
+	opts := c.launchOptionsFor("/usr/local/bin/packer-plugin-bird")
+	if opts == nil {
+		t.Fatal("expected launch options to be found by plugin name")
+	}
+}
+
+// Test_discover_appliesLaunchOptions proves that a configured LaunchOptions
+// entry actually reaches a plugin Discover() spawns, not just the exec.Cmd
+// applyLaunchOptions builds in isolation: it runs a real mock plugin
+// through the sh-wrapper harness shared with Test_multiplugin_describe and
+// has the wrapper write out the env var plugins.hcl is supposed to inject,
+// before describing itself back over RPC like any other multi-plugin.
+func Test_discover_appliesLaunchOptions(t *testing.T) {
+	MustHaveExec(t)
+	shPath := MustHaveCommand(t, "sh")
+
+	pluginDir, err := ioutil.TempDir("", "pkr-launch-options-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(pluginDir)
+
+	envMarker := path.Join(pluginDir, "env.out")
+
+	mockPlugins["echotest"] = pluginsdk.Set{
+		Builders: map[string]packer.Builder{"echo": nil},
+	}
+	defer delete(mockPlugins, "echotest")
+
+	pluginPath := path.Join(pluginDir, "packer-plugin-echotest")
+	fileContent := fmt.Sprintf("#!%s\n", shPath)
+	fileContent += fmt.Sprintf("printf '%%s' \"$PKR_LAUNCH_OPTIONS_TEST\" > %s\n", envMarker)
+	fileContent += strings.Join(
+		append([]string{"PKR_WANT_TEST_PLUGINS=1"}, helperCommand(t, "echotest", "$@")...),
+		" ")
+	if err := ioutil.WriteFile(pluginPath, []byte(fileContent), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	os.Setenv("PACKER_PLUGIN_PATH", pluginDir)
+	defer os.Unsetenv("PACKER_PLUGIN_PATH")
+
+	c := newConfig()
+	c.LaunchOptions = map[string]*LaunchOptions{
+		"echotest": {
+			Env: map[string]string{"PKR_LAUNCH_OPTIONS_TEST": "hello-from-plugins-hcl"},
+		},
+	}
+
+	if err := c.Discover(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, found := c.builders["echotest-echo"]; !found {
+		t.Fatalf("expected to find the echotest-echo builder")
+	}
+
+	got, err := ioutil.ReadFile(envMarker)
+	if err != nil {
+		t.Fatalf("expected the spawned plugin process to have written %s: %s", envMarker, err)
+	}
+	if string(got) != "hello-from-plugins-hcl" {
+		t.Errorf("expected the spawned plugin to see the configured env var, got: %q", got)
+	}
+}
@@ -0,0 +1,179 @@
+package plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// manifestSuffix is appended to a plugin binary's filename to find its
+// manifest, e.g. "packer-plugin-amazon" looks for
+// "packer-plugin-amazon.manifest.json" in the same directory.
+const manifestSuffix = ".manifest.json"
+
+// PluginManifest describes a plugin binary without requiring Packer to
+// launch it and perform an RPC "describe" round-trip. It is optional:
+// plugins without a manifest are still discovered via the filename
+// convention and describe RPC as before.
+type PluginManifest struct {
+	// Id is a stable, reverse-DNS-style identifier for the plugin, e.g.
+	// "com.example.packer-plugin-foo".
+	Id string `json:"id"`
+
+	// Version is the plugin's own semver version.
+	Version string `json:"version"`
+
+	// MinPackerVersion is the minimum Packer (or SDK) version the plugin
+	// requires. Discover() refuses to load the plugin if the running
+	// Packer is older than this.
+	MinPackerVersion string `json:"min_packer_version"`
+
+	// Description is a short, human-readable summary shown by
+	// `packer plugins list`.
+	Description string `json:"description"`
+
+	// Builders, Provisioners and PostProcessors list the component names
+	// this plugin binary provides, letting Discover() register them
+	// without an RPC describe call.
+	Builders       []string `json:"builders,omitempty"`
+	Provisioners   []string `json:"provisioners,omitempty"`
+	PostProcessors []string `json:"post_processors,omitempty"`
+}
+
+// ParseManifest decodes a manifest.json payload.
+func ParseManifest(data []byte) (*PluginManifest, error) {
+	var m PluginManifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("error parsing plugin manifest: %s", err)
+	}
+
+	if m.Id == "" {
+		return nil, fmt.Errorf("plugin manifest is missing required field %q", "id")
+	}
+	if m.Version == "" {
+		return nil, fmt.Errorf("plugin manifest is missing required field %q", "version")
+	}
+
+	return &m, nil
+}
+
+func manifestPath(binaryPath string) string {
+	return binaryPath + manifestSuffix
+}
+
+// satisfiesMinVersion reports whether running is >= min. Both are expected
+// to be dotted numeric versions (e.g. "1.7.0"); a missing min is always
+// satisfied.
+func satisfiesMinVersion(running, min string) bool {
+	if min == "" {
+		return true
+	}
+
+	runningParts := versionParts(running)
+	minParts := versionParts(min)
+
+	for i := 0; i < len(minParts); i++ {
+		var r int
+		if i < len(runningParts) {
+			r = runningParts[i]
+		}
+		if r > minParts[i] {
+			return true
+		}
+		if r < minParts[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func versionParts(v string) []int {
+	fields := strings.Split(v, ".")
+	parts := make([]int, len(fields))
+	for i, f := range fields {
+		n, err := strconv.Atoi(strings.TrimSpace(f))
+		if err != nil {
+			n = 0
+		}
+		parts[i] = n
+	}
+	return parts
+}
+
+// loadManifest reads and validates the manifest colocated with binaryPath,
+// if any. It returns a nil manifest, and no error, when no manifest file
+// is present.
+func loadManifest(binaryPath string) (*PluginManifest, error) {
+	data, err := readFileIfExists(manifestPath(binaryPath))
+	if err != nil {
+		return nil, err
+	}
+	if data == nil {
+		return nil, nil
+	}
+
+	m, err := ParseManifest(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", filepath.Base(manifestPath(binaryPath)), err)
+	}
+
+	return m, nil
+}
+
+// discoverManifest loads the manifest for a discovered multi-plugin binary,
+// if present, and registers its components directly -- skipping the RPC
+// describe round-trip. It reports whether a manifest was found at all, and
+// whether it was actually registered: a manifest whose MinPackerVersion
+// isn't satisfied is found but not registered, and the caller shouldn't
+// treat the plugin as loaded (e.g. by recording a checksum for it).
+func (c *Config) discoverManifest(name, path string) (found bool, registered bool, err error) {
+	manifest, err := loadManifest(path)
+	if err != nil {
+		return false, false, err
+	}
+	if manifest == nil {
+		return false, false, nil
+	}
+
+	if !satisfiesMinVersion(Version, manifest.MinPackerVersion) {
+		log.Printf(
+			"[WARN] Skipping plugin %s (%s): requires Packer >= %s, running %s",
+			name, path, manifest.MinPackerVersion, Version)
+		return true, false, nil
+	}
+
+	if c.Manifests == nil {
+		c.Manifests = make(map[string]*PluginManifest)
+	}
+	c.Manifests[name] = manifest
+
+	for _, builderName := range manifest.Builders {
+		fullName := componentName(name, builderName)
+		c.builders[fullName] = &pluginBuilder{name: builderName, path: path, config: c}
+	}
+	for _, provisionerName := range manifest.Provisioners {
+		fullName := componentName(name, provisionerName)
+		c.provisioners[fullName] = &pluginProvisioner{name: provisionerName, path: path, config: c}
+	}
+	for _, postProcessorName := range manifest.PostProcessors {
+		fullName := componentName(name, postProcessorName)
+		c.postProcessors[fullName] = &pluginPostProcessor{name: postProcessorName, path: path, config: c}
+	}
+
+	return true, true, nil
+}
+
+// componentName mirrors the "<plugin>-<component>" naming used for
+// describe-based multi-plugin discovery, except that the plugin's "default"
+// component (sharing the plugin's own name) is registered under the plain
+// plugin name instead, matching legacy single-purpose plugin naming.
+func componentName(pluginName, componentName string) string {
+	if componentName == "" || componentName == pluginName {
+		return pluginName
+	}
+	return pluginName + "-" + componentName
+}
@@ -0,0 +1,147 @@
+package plugin
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseManifest(t *testing.T) {
+	raw := `{
+		"id": "com.example.packer-plugin-bird",
+		"version": "1.2.3",
+		"min_packer_version": "1.0.0",
+		"description": "bird plugin",
+		"builders": ["feather", "guacamole"]
+	}`
+
+	m, err := ParseManifest([]byte(raw))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if m.Id != "com.example.packer-plugin-bird" {
+		t.Fatalf("unexpected id: %s", m.Id)
+	}
+	if len(m.Builders) != 2 {
+		t.Fatalf("expected 2 builders, got %d", len(m.Builders))
+	}
+}
+
+func TestParseManifest_missingId(t *testing.T) {
+	_, err := ParseManifest([]byte(`{"version": "1.0.0"}`))
+	if err == nil {
+		t.Fatal("expected error for missing id")
+	}
+}
+
+func TestSatisfiesMinVersion(t *testing.T) {
+	cases := []struct {
+		running, min string
+		want         bool
+	}{
+		{"1.7.0", "", true},
+		{"1.7.0", "1.7.0", true},
+		{"1.7.0", "1.6.0", true},
+		{"1.7.0", "1.8.0", false},
+		{"1.7.1", "1.7.0", true},
+		{"1.7.0", "1.7.1", false},
+	}
+
+	for _, tc := range cases {
+		if got := satisfiesMinVersion(tc.running, tc.min); got != tc.want {
+			t.Errorf("satisfiesMinVersion(%q, %q) = %v, want %v", tc.running, tc.min, got, tc.want)
+		}
+	}
+}
+
+func TestDiscover_manifestAndDescribeMixed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pkr-manifest-test")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// A manifest-based plugin: the binary content doesn't matter since
+	// Discover() should never need to execute it.
+	birdBinary := filepath.Join(dir, "packer-plugin-bird")
+	if err := ioutil.WriteFile(birdBinary, []byte("#!/bin/sh\nexit 1\n"), 0755); err != nil {
+		t.Fatalf("failed to write fake plugin: %s", err)
+	}
+
+	manifest := `{
+		"id": "com.example.packer-plugin-bird",
+		"version": "1.0.0",
+		"builders": ["feather", "guacamole"]
+	}`
+	if err := ioutil.WriteFile(birdBinary+manifestSuffix, []byte(manifest), 0644); err != nil {
+		t.Fatalf("failed to write manifest: %s", err)
+	}
+
+	// A legacy single-purpose plugin discovered purely by filename.
+	provisionerBinary := filepath.Join(dir, ProvisionerPluginPrefix+"partyparrot")
+	if err := ioutil.WriteFile(provisionerBinary, []byte(""), 0644); err != nil {
+		t.Fatalf("failed to write fake plugin: %s", err)
+	}
+
+	os.Setenv("PACKER_PLUGIN_PATH", dir)
+	defer os.Unsetenv("PACKER_PLUGIN_PATH")
+
+	c := newConfig()
+	if err := c.Discover(); err != nil {
+		t.Fatalf("Discover() returned error: %s", err)
+	}
+
+	for _, name := range []string{"bird-feather", "bird-guacamole"} {
+		if _, ok := c.builders[name]; !ok {
+			t.Errorf("expected manifest-based builder %q to be registered", name)
+		}
+	}
+
+	if _, ok := c.provisioners["partyparrot"]; !ok {
+		t.Error("expected legacy provisioner partyparrot to be registered")
+	}
+
+	if _, ok := c.Manifests["bird"]; !ok {
+		t.Error("expected bird manifest to be recorded on Config.Manifests")
+	}
+}
+
+func TestDiscover_manifestSkipsOnMinVersion(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pkr-manifest-minver-test")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	binary := filepath.Join(dir, "packer-plugin-toooold")
+	if err := ioutil.WriteFile(binary, []byte(""), 0755); err != nil {
+		t.Fatalf("failed to write fake plugin: %s", err)
+	}
+
+	manifest := `{
+		"id": "com.example.packer-plugin-toooold",
+		"version": "1.0.0",
+		"min_packer_version": "999.0.0",
+		"builders": ["foo"]
+	}`
+	if err := ioutil.WriteFile(binary+manifestSuffix, []byte(manifest), 0644); err != nil {
+		t.Fatalf("failed to write manifest: %s", err)
+	}
+
+	os.Setenv("PACKER_PLUGIN_PATH", dir)
+	defer os.Unsetenv("PACKER_PLUGIN_PATH")
+
+	c := newConfig()
+	if err := c.Discover(); err != nil {
+		t.Fatalf("Discover() returned error: %s", err)
+	}
+
+	if _, ok := c.builders["toooold-foo"]; ok {
+		t.Error("expected builder requiring a too-new Packer version to be skipped")
+	}
+
+	if _, ok := c.Checksums["toooold-foo"]; ok {
+		t.Error("expected no checksum to be recorded for a plugin skipped on min version")
+	}
+}
@@ -0,0 +1,260 @@
+package plugin
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	pluginsdk "github.com/hashicorp/packer/packer-plugin-sdk/plugin"
+)
+
+// Tuning parameters for every Supervisor. They're package-level vars,
+// rather than constants, so tests can shrink the timings instead of
+// waiting out real backoff/health-check intervals.
+var (
+	SupervisorHealthInterval = 5 * time.Second
+	SupervisorPingTimeout    = 2 * time.Second
+	SupervisorMinBackoff     = 1 * time.Second
+	SupervisorMaxBackoff     = 30 * time.Second
+	SupervisorStablePeriod   = 60 * time.Second
+	SupervisorRestartBudget  = 5
+	SupervisorRestartWindow  = 5 * time.Minute
+)
+
+type supervisorState int
+
+const (
+	supervisorRunning supervisorState = iota
+	supervisorFailed
+)
+
+// Supervisor owns the lifecycle of a single launched plugin binary: it
+// starts the process, health-checks it over its existing RPC channel every
+// SupervisorHealthInterval, and restarts it with capped exponential
+// backoff on unexpected exit. If a plugin exceeds its restart budget
+// within a window, the Supervisor gives up and reports a permanent
+// failure to every caller.
+//
+// Supervisor is transparent to Builder/Provisioner/PostProcessor callers:
+// the pluginBuilder/pluginProvisioner/pluginPostProcessor proxies returned
+// from discovery call Client() on every method invocation, so a restart
+// between two calls is invisible to them.
+type Supervisor struct {
+	path   string
+	config *Config
+
+	mu        sync.Mutex
+	client    *pluginsdk.Client
+	state     supervisorState
+	stopped   bool
+	err       error
+	backoff   time.Duration
+	restarts  []time.Time
+	startedAt time.Time
+
+	stopOnce sync.Once
+	stopCh   chan struct{}
+}
+
+// NewSupervisor creates a Supervisor for the plugin binary at path. The
+// process is not started until the first call to Client().
+func NewSupervisor(c *Config, path string) *Supervisor {
+	return &Supervisor{
+		path:    path,
+		config:  c,
+		backoff: SupervisorMinBackoff,
+		stopCh:  make(chan struct{}),
+	}
+}
+
+// Client returns the Supervisor's currently-healthy RPC client, launching
+// the plugin on first call. If the plugin has exhausted its restart
+// budget, Client returns the permanent failure error instead.
+func (s *Supervisor) Client() (*pluginsdk.Client, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.state == supervisorFailed {
+		return nil, s.err
+	}
+
+	if s.client == nil {
+		if err := s.launchLocked(); err != nil {
+			return nil, err
+		}
+		go s.monitor()
+	}
+
+	return s.client, nil
+}
+
+func (s *Supervisor) launchLocked() error {
+	client, err := s.config.client(s.path)
+	if err != nil {
+		return fmt.Errorf("error launching plugin %s: %s", s.path, err)
+	}
+	s.client = client
+	s.startedAt = time.Now()
+	return nil
+}
+
+func (s *Supervisor) monitor() {
+	ticker := time.NewTicker(SupervisorHealthInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stopCh:
+			return
+		case <-ticker.C:
+			if s.checkHealth() {
+				return
+			}
+		}
+	}
+}
+
+// checkHealth pings the plugin and, if it's no longer responding,
+// attempts a backoff-restart. It returns true once the supervisor has
+// permanently failed, so monitor() can stop ticking.
+//
+// The lock is held only to read/update Supervisor state, never across the
+// RPC ping itself or the backoff sleep: a wedged (rather than crashed)
+// plugin must not be able to block every other Client() caller for the
+// duration of the health check or the restart backoff.
+func (s *Supervisor) checkHealth() bool {
+	s.mu.Lock()
+	if s.state == supervisorFailed || s.stopped {
+		s.mu.Unlock()
+		return true
+	}
+	client, startedAt := s.client, s.startedAt
+	s.mu.Unlock()
+
+	if ping(client) {
+		s.mu.Lock()
+		if time.Since(startedAt) >= SupervisorStablePeriod {
+			s.backoff = SupervisorMinBackoff
+		}
+		s.mu.Unlock()
+		return false
+	}
+
+	log.Printf("[WARN] plugin %s is not responding, restarting", s.path)
+
+	s.mu.Lock()
+	s.recordRestartLocked()
+	failed, backoff := s.state == supervisorFailed, s.backoff
+	s.mu.Unlock()
+	if failed {
+		return true
+	}
+
+	time.Sleep(backoff)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopped {
+		// Stop() ran while we were sleeping off the backoff: launching now
+		// would spawn a process that nothing is left to kill.
+		return true
+	}
+	if err := s.launchLocked(); err != nil {
+		log.Printf("[ERR] failed to restart plugin %s: %s", s.path, err)
+		return false
+	}
+
+	log.Printf("[INFO] restarted plugin %s after a %s backoff", s.path, backoff)
+	s.backoff *= 2
+	if s.backoff > SupervisorMaxBackoff {
+		s.backoff = SupervisorMaxBackoff
+	}
+
+	return false
+}
+
+// ping reports whether client responds to an RPC ping within
+// SupervisorPingTimeout. A plugin that hangs rather than exits must still
+// be detected and restarted, not left to block its Supervisor forever.
+func ping(client *pluginsdk.Client) bool {
+	if client == nil || client.Exited() {
+		return false
+	}
+
+	protocol, err := client.Client()
+	if err != nil {
+		return false
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- protocol.Ping() }()
+
+	select {
+	case err := <-done:
+		return err == nil
+	case <-time.After(SupervisorPingTimeout):
+		return false
+	}
+}
+
+// recordRestartLocked tracks this restart against the rolling window and
+// marks the supervisor permanently failed if the budget is exceeded.
+func (s *Supervisor) recordRestartLocked() {
+	now := time.Now()
+	cutoff := now.Add(-SupervisorRestartWindow)
+
+	kept := s.restarts[:0]
+	for _, t := range s.restarts {
+		if t.After(cutoff) {
+			kept = append(kept, t)
+		}
+	}
+	s.restarts = append(kept, now)
+
+	if len(s.restarts) > SupervisorRestartBudget {
+		s.state = supervisorFailed
+		s.err = fmt.Errorf(
+			"plugin %s crashed %d times within %s, exceeding its restart budget of %d; giving up",
+			s.path, len(s.restarts), SupervisorRestartWindow, SupervisorRestartBudget)
+		log.Printf("[ERR] %s", s.err)
+	}
+}
+
+// Stop halts health-checking and kills the underlying process, if any. It
+// also marks the Supervisor stopped under s.mu so a checkHealth that's
+// mid-backoff-sleep when Stop is called won't launch a replacement process
+// after the fact; whichever of the two reaches s.client last under the
+// lock is the one that determines whether a process ends up killed or
+// orphaned, and this ordering guarantees it's never orphaned.
+func (s *Supervisor) Stop() {
+	s.stopOnce.Do(func() {
+		close(s.stopCh)
+	})
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stopped = true
+	if s.client != nil {
+		s.client.Kill()
+	}
+}
+
+// supervisorFor returns the Supervisor for the plugin binary at path,
+// creating one on first use.
+func (c *Config) supervisorFor(path string) *Supervisor {
+	c.supervisorsMu.Lock()
+	defer c.supervisorsMu.Unlock()
+
+	if c.supervisors == nil {
+		c.supervisors = make(map[string]*Supervisor)
+	}
+
+	sup, ok := c.supervisors[path]
+	if !ok {
+		sup = NewSupervisor(c, path)
+		c.supervisors[path] = sup
+	}
+
+	return sup
+}
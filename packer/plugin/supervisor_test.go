@@ -0,0 +1,142 @@
+package plugin
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	pluginsdk "github.com/hashicorp/packer/packer-plugin-sdk/plugin"
+)
+
+// withFastSupervisorTuning shrinks the Supervisor's timings for the
+// duration of a test so it doesn't have to wait out real-world backoff
+// and health-check intervals.
+func withFastSupervisorTuning(t *testing.T) {
+	t.Helper()
+
+	origHealth := SupervisorHealthInterval
+	origMin := SupervisorMinBackoff
+	origStable := SupervisorStablePeriod
+
+	SupervisorHealthInterval = 25 * time.Millisecond
+	SupervisorMinBackoff = 10 * time.Millisecond
+	SupervisorStablePeriod = time.Hour
+
+	t.Cleanup(func() {
+		SupervisorHealthInterval = origHealth
+		SupervisorMinBackoff = origMin
+		SupervisorStablePeriod = origStable
+	})
+}
+
+func Test_multiplugin_supervisor_restart(t *testing.T) {
+	withFastSupervisorTuning(t)
+
+	pluginDir, err := ioutil.TempDir("", "pkr-supervisor-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(pluginDir)
+
+	shPath := MustHaveCommand(t, "sh")
+	pluginPath := path.Join(pluginDir, "packer-plugin-bird")
+	fileContent := fmt.Sprintf("#!%s\n", shPath)
+	fileContent += strings.Join(
+		append([]string{"PKR_WANT_TEST_PLUGINS=1"}, helperCommand(t, "bird", "$@")...), " ")
+	ioutil.WriteFile(pluginPath, []byte(fileContent), os.ModePerm)
+
+	c := newConfig()
+	sup := c.supervisorFor(pluginPath)
+	defer sup.Stop()
+
+	client, err := sup.Client()
+	if err != nil {
+		t.Fatalf("expected supervisor to launch the plugin: %s", err)
+	}
+
+	// Simulate a mid-build crash.
+	client.Kill()
+
+	// Give the monitor goroutine a chance to notice the dead process and
+	// restart it.
+	deadline := time.Now().Add(2 * time.Second)
+	var restarted *pluginsdk.Client
+	for time.Now().Before(deadline) {
+		restarted, err = sup.Client()
+		if err == nil && restarted != client {
+			break
+		}
+		time.Sleep(25 * time.Millisecond)
+	}
+
+	if err != nil {
+		t.Fatalf("expected the supervisor to recover from the crash, got error: %s", err)
+	}
+	if restarted == client {
+		t.Fatal("expected the supervisor to hand back a freshly restarted client")
+	}
+}
+
+func Test_multiplugin_supervisor_givesUpAfterBudget(t *testing.T) {
+	withFastSupervisorTuning(t)
+	SupervisorRestartBudget = 1
+	SupervisorRestartWindow = time.Hour
+	t.Cleanup(func() {
+		SupervisorRestartBudget = 5
+		SupervisorRestartWindow = 5 * time.Minute
+	})
+
+	pluginDir, err := ioutil.TempDir("", "pkr-supervisor-budget-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(pluginDir)
+
+	shPath := MustHaveCommand(t, "sh")
+	pluginPath := path.Join(pluginDir, "packer-plugin-bird")
+	fileContent := fmt.Sprintf("#!%s\n", shPath)
+	fileContent += strings.Join(
+		append([]string{"PKR_WANT_TEST_PLUGINS=1"}, helperCommand(t, "bird", "$@")...), " ")
+	ioutil.WriteFile(pluginPath, []byte(fileContent), os.ModePerm)
+
+	c := newConfig()
+	sup := c.supervisorFor(pluginPath)
+	defer sup.Stop()
+
+	// recordRestartLocked only fails once more than SupervisorRestartBudget
+	// restarts have been recorded, so with a budget of 1 we need to crash
+	// the plugin twice: the first restart is still within budget and the
+	// mock plugin comes back healthy, so it has to be killed again.
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		sup.mu.Lock()
+		failed := sup.state == supervisorFailed
+		sup.mu.Unlock()
+		if failed {
+			break
+		}
+
+		client, err := sup.Client()
+		if err != nil {
+			break
+		}
+		client.Kill()
+
+		time.Sleep(25 * time.Millisecond)
+	}
+
+	sup.mu.Lock()
+	failed := sup.state == supervisorFailed
+	sup.mu.Unlock()
+	if !failed {
+		t.Fatal("expected the supervisor to have recorded a permanent failure")
+	}
+
+	if _, err := sup.Client(); err == nil {
+		t.Fatal("expected the supervisor to report a permanent failure once its restart budget is exhausted")
+	}
+}
@@ -0,0 +1,154 @@
+package plugin
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/crypto/openpgp"
+)
+
+func generateTestKey(t *testing.T) *openpgp.Entity {
+	t.Helper()
+
+	entity, err := openpgp.NewEntity("packer test", "", "packer-test@example.com", nil)
+	if err != nil {
+		t.Fatalf("failed to generate ephemeral test key: %s", err)
+	}
+	return entity
+}
+
+func signPlugin(t *testing.T, entity *openpgp.Entity, pluginPath string) []byte {
+	t.Helper()
+
+	f, err := os.Open(pluginPath)
+	if err != nil {
+		t.Fatalf("failed to open plugin for signing: %s", err)
+	}
+	defer f.Close()
+
+	var sig bytes.Buffer
+	if err := openpgp.DetachSign(&sig, entity, f, nil); err != nil {
+		t.Fatalf("failed to sign plugin: %s", err)
+	}
+	return sig.Bytes()
+}
+
+func writePlugin(t *testing.T, dir, name string, content []byte) string {
+	t.Helper()
+
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, content, 0755); err != nil {
+		t.Fatalf("failed to write plugin: %s", err)
+	}
+	return path
+}
+
+func TestVerifyPlugin_enforceGoodChecksumAndSignature(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pkr-trust-test")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	entity := generateTestKey(t)
+	pluginPath := writePlugin(t, dir, ProvisionerPluginPrefix+"partyparrot", []byte("#!/bin/sh\nexit 1\n"))
+
+	sum, err := sha256sum(pluginPath)
+	if err != nil {
+		t.Fatalf("failed to checksum plugin: %s", err)
+	}
+	if err := ioutil.WriteFile(pluginPath+checksumSuffix, []byte(sum), 0644); err != nil {
+		t.Fatalf("failed to write checksum sidecar: %s", err)
+	}
+	if err := ioutil.WriteFile(pluginPath+signatureSuffix, signPlugin(t, entity, pluginPath), 0644); err != nil {
+		t.Fatalf("failed to write signature sidecar: %s", err)
+	}
+
+	os.Setenv("PACKER_PLUGIN_PATH", dir)
+	defer os.Unsetenv("PACKER_PLUGIN_PATH")
+
+	c := newConfig()
+	c.PluginTrust = TrustEnforce
+	c.TrustedKeys = openpgp.EntityList{entity}
+
+	if err := c.Discover(); err != nil {
+		t.Fatalf("Discover() returned error: %s", err)
+	}
+
+	if _, ok := c.provisioners["partyparrot"]; !ok {
+		t.Error("expected verified provisioner to be registered")
+	}
+	if c.Checksums["partyparrot"] != sum {
+		t.Errorf("expected recorded checksum %q, got %q", sum, c.Checksums["partyparrot"])
+	}
+}
+
+func TestVerifyPlugin_enforceRejectsTamperedBinary(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pkr-trust-tamper-test")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	entity := generateTestKey(t)
+	pluginPath := writePlugin(t, dir, ProvisionerPluginPrefix+"partyparrot", []byte("#!/bin/sh\nexit 1\n"))
+
+	sum, err := sha256sum(pluginPath)
+	if err != nil {
+		t.Fatalf("failed to checksum plugin: %s", err)
+	}
+	if err := ioutil.WriteFile(pluginPath+checksumSuffix, []byte(sum), 0644); err != nil {
+		t.Fatalf("failed to write checksum sidecar: %s", err)
+	}
+	if err := ioutil.WriteFile(pluginPath+signatureSuffix, signPlugin(t, entity, pluginPath), 0644); err != nil {
+		t.Fatalf("failed to write signature sidecar: %s", err)
+	}
+
+	// Tamper with the binary after the checksum/signature were computed.
+	if err := ioutil.WriteFile(pluginPath, []byte("#!/bin/sh\necho pwned\n"), 0755); err != nil {
+		t.Fatalf("failed to tamper with plugin: %s", err)
+	}
+
+	os.Setenv("PACKER_PLUGIN_PATH", dir)
+	defer os.Unsetenv("PACKER_PLUGIN_PATH")
+
+	c := newConfig()
+	c.PluginTrust = TrustEnforce
+	c.TrustedKeys = openpgp.EntityList{entity}
+
+	if err := c.Discover(); err != nil {
+		t.Fatalf("Discover() returned error: %s", err)
+	}
+
+	if _, ok := c.provisioners["partyparrot"]; ok {
+		t.Error("expected tampered provisioner to be refused under TrustEnforce")
+	}
+}
+
+func TestVerifyPlugin_warnRegistersDespiteFailure(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pkr-trust-warn-test")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// No checksum or signature sidecars at all.
+	writePlugin(t, dir, ProvisionerPluginPrefix+"partyparrot", []byte(""))
+
+	os.Setenv("PACKER_PLUGIN_PATH", dir)
+	defer os.Unsetenv("PACKER_PLUGIN_PATH")
+
+	c := newConfig()
+	c.PluginTrust = TrustWarn
+
+	if err := c.Discover(); err != nil {
+		t.Fatalf("Discover() returned error: %s", err)
+	}
+
+	if _, ok := c.provisioners["partyparrot"]; !ok {
+		t.Error("expected TrustWarn to still register an unverified provisioner")
+	}
+}
@@ -0,0 +1,19 @@
+package plugin
+
+import (
+	"io/ioutil"
+	"os"
+)
+
+// readFileIfExists returns the contents of path, or nil if path does not
+// exist. Any other error is returned to the caller.
+func readFileIfExists(path string) ([]byte, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return data, nil
+}
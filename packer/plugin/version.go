@@ -0,0 +1,5 @@
+package plugin
+
+// Version is the running Packer version, used to enforce the
+// min_packer_version constraint declared in a plugin's manifest.
+var Version = "1.7.0"